@@ -0,0 +1,244 @@
+package binclude
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// WriteTar writes every file in fs to w as a PAX-format tar archive, using
+// forward-slash paths and preserving Filename, Mode and ModTime. Content is
+// always written fully decompressed, regardless of the file's current
+// Compression, so the archive is a plain, self-contained file tree.
+func (fs *FileSystem) WriteTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	for _, p := range sortedFilePaths(fs.Files) {
+		file := fs.Files[p]
+
+		content, err := originalContent(file)
+		if err != nil {
+			return fmt.Errorf("binclude: tar %s: %v", p, err)
+		}
+
+		hdr := &tar.Header{
+			Format:  tar.FormatPAX,
+			Name:    p,
+			Mode:    int64(file.Mode.Perm()),
+			ModTime: file.ModTime,
+			Size:    int64(len(content)),
+		}
+		if file.Mode.IsDir() {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+			hdr.Size = 0
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !file.Mode.IsDir() {
+			if _, err := tw.Write(content); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Close()
+}
+
+// LoadTar builds a *FileSystem from a tar archive written by WriteTar (or
+// any tar archive using forward-slash paths). Loaded files are uncompressed
+// (Compression == None) and, like every other live File in this package,
+// hex-encoded in Content, ready to use via Open/ReadFile/Decompress or to
+// pass through Encode/EncodeSelect.
+func LoadTar(r io.Reader) (*FileSystem, error) {
+	tr := tar.NewReader(r)
+
+	fsys := &FileSystem{Files: make(Files)}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+
+		file := &File{
+			Filename: path.Base(name),
+			Mode:     hdr.FileInfo().Mode(),
+			ModTime:  hdr.ModTime,
+		}
+
+		if hdr.Typeflag != tar.TypeDir {
+			content, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			file.Content = []byte(hex.EncodeToString(content))
+		}
+
+		fsys.Files[name] = file
+	}
+
+	return fsys, nil
+}
+
+// WriteZip writes every file in fs to w as a zip archive, preserving
+// Filename, Mode and ModTime. Content is decompressed and deflated by the
+// zip writer, except for files whose Compression is already Gzip: those
+// are written Stored, keeping the existing gzip-compressed bytes as-is
+// instead of compressing them a second time.
+func (fs *FileSystem) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	for _, p := range sortedFilePaths(fs.Files) {
+		file := fs.Files[p]
+
+		name := p
+		method := zip.Deflate
+		var content []byte
+		var err error
+
+		switch {
+		case file.Mode.IsDir():
+			name += "/"
+			method = zip.Store
+		case file.Compression == Gzip:
+			method = zip.Store
+			content, err = hexDecodeContent(file)
+		default:
+			content, err = originalContent(file)
+		}
+		if err != nil {
+			return fmt.Errorf("binclude: zip %s: %v", p, err)
+		}
+
+		hdr := &zip.FileHeader{
+			Name:     name,
+			Method:   method,
+			Modified: file.ModTime,
+		}
+		hdr.SetMode(file.Mode)
+
+		ew, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if !file.Mode.IsDir() {
+			if _, err := ew.Write(content); err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+// LoadZip builds a *FileSystem from a zip archive written by WriteZip (or
+// any zip archive). A Stored entry starting with the gzip magic bytes is
+// loaded as an already-compressed Gzip file; every other entry is loaded
+// uncompressed (Compression == None). Either way Content ends up
+// hex-encoded, like every other live File in this package.
+func LoadZip(r io.ReaderAt, size int64) (*FileSystem, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := &FileSystem{Files: make(Files)}
+
+	for _, zf := range zr.File {
+		name := strings.TrimSuffix(zf.Name, "/")
+
+		file := &File{
+			Filename: path.Base(name),
+			Mode:     zf.Mode(),
+			ModTime:  zf.Modified,
+		}
+
+		if !zf.Mode().IsDir() {
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, err
+			}
+			content, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			file.Content = []byte(hex.EncodeToString(content))
+			if zf.Method == zip.Store && len(content) >= 2 && content[0] == 0x1f && content[1] == 0x8b {
+				file.Compression = Gzip
+			}
+		}
+
+		fsys.Files[name] = file
+	}
+
+	return fsys, nil
+}
+
+// sortedFilePaths returns files' keys sorted lexically, so WriteTar/WriteZip
+// output doesn't depend on Go's random map iteration order.
+func sortedFilePaths(files Files) []string {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// hexDecodeContent hex-decodes file.Content as stored, without touching any
+// codec compression on top of it.
+func hexDecodeContent(file *File) ([]byte, error) {
+	dst := make([]byte, hex.DecodedLen(len(file.Content)))
+	_, err := hex.Decode(dst, file.Content)
+
+	return dst, err
+}
+
+// originalContent returns file's fully decompressed content: hex-decoded
+// and, if Compression is set, run through the registered Codec. fs.Files
+// itself is left untouched.
+func originalContent(file *File) ([]byte, error) {
+	if file.Mode.IsDir() {
+		return nil, nil
+	}
+
+	dst, err := hexDecodeContent(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Compression == None {
+		return dst, nil
+	}
+
+	codec, err := codecFor(file.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := codec.Decode(bytes.NewReader(dst))
+	if err != nil {
+		return nil, fmt.Errorf("%s decode err: %v", codec.Name(), err)
+	}
+	defer decoded.Close()
+
+	return ioutil.ReadAll(decoded)
+}
@@ -0,0 +1,70 @@
+package binclude
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestLoadTarDecompress ensures a FileSystem round-tripped through
+// WriteTar/LoadTar keeps Content in the hex-encoded form every other live
+// File in this package assumes, so Decompress (and anything else that
+// hex-decodes Content) works on it.
+func TestLoadTarDecompress(t *testing.T) {
+	want := "hello archive"
+
+	src := &FileSystem{Files: Files{
+		"a.txt": {Filename: "a.txt", Content: []byte(hex.EncodeToString([]byte(want)))},
+	}}
+
+	var buf bytes.Buffer
+	if err := src.WriteTar(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadTar(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.Decompress(); err != nil {
+		t.Fatalf("Decompress on a tar-loaded FileSystem failed: %v", err)
+	}
+
+	if got := string(loaded.Files["a.txt"].Content); got != want {
+		t.Fatalf("Content = %q, want %q", got, want)
+	}
+}
+
+// TestWriteTarExcludedMimetype guards against WriteTar aborting on a live
+// FileSystem containing a shouldCompress-excluded file (e.g. a PNG) left
+// un-hex-encoded by EncodeSelect, which made originalContent's hex.Decode
+// fail with "invalid byte" for that entry.
+func TestWriteTarExcludedMimetype(t *testing.T) {
+	png := append([]byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}, bytes.Repeat([]byte{0, 1, 2, 3}, 16)...)
+
+	fsys := &FileSystem{Files: Files{
+		"a.png": {Filename: "a.png", Content: append([]byte(nil), png...)},
+	}}
+
+	if err := fsys.Encode(Gzip); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := fsys.WriteTar(&buf); err != nil {
+		t.Fatalf("WriteTar failed on a shouldCompress-excluded file: %v", err)
+	}
+
+	loaded, err := LoadTar(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.Decompress(); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Files["a.png"].Content; !bytes.Equal(got, png) {
+		t.Fatalf("a.png Content = %x, want %x", got, png)
+	}
+}
@@ -2,15 +2,18 @@ package binclude
 
 import (
 	"bytes"
-	"compress/gzip"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -32,10 +35,42 @@ func Include(name string) string { return name }
 // Paths are seperated by a newline (noop)
 func IncludeFromFile(name string) {}
 
+// IncludeGlob includes every file/directory matching pattern relative to the
+// package path (noop). Patterns use doublestar-style "**" semantics, see
+// github.com/bmatcuk/doublestar for the exact syntax supported.
+// This function returns the pattern to make it usable in global variable definitions.
+func IncludeGlob(pattern string) string { return pattern }
+
+// Exclude removes every already included file/directory matching pattern
+// (doublestar-style, see IncludeGlob) from the generated FileSystem (noop).
+func Exclude(pattern string) {}
+
 // FileSystem implements access to a collection of named files.
 type FileSystem struct {
 	Files
 	sync.RWMutex
+
+	// CompressionConcurrency sets how many files are compressed in
+	// parallel by Encode. If <= 0, runtime.NumCPU() is used.
+	CompressionConcurrency int
+
+	dirIndexOnce sync.Once
+	dirIndex     map[string][]string
+}
+
+// dirEntries returns the paths directly contained in dir, building and
+// caching a parent-dir index on first use so repeated calls (e.g. from
+// File.Readdir) don't rescan every entry in Files.
+func (fs *FileSystem) dirEntries(dir string) []string {
+	fs.dirIndexOnce.Do(func() {
+		fs.dirIndex = make(map[string][]string, len(fs.Files))
+		for path := range fs.Files {
+			parent := filepath.Dir(path)
+			fs.dirIndex[parent] = append(fs.dirIndex[parent], path)
+		}
+	})
+
+	return fs.dirIndex[dir]
 }
 
 type Files map[string]*File
@@ -43,6 +78,9 @@ type Files map[string]*File
 // check that the http.FileSystem interface is implemented
 var _ http.FileSystem = new(FileSystem)
 
+// check that the http.Handler interface is implemented
+var _ http.Handler = new(FileSystem)
+
 // Open returns a File using the http.File interface
 func (fs *FileSystem) Open(name string) (http.File, error) {
 	if Debug {
@@ -101,6 +139,302 @@ func (fs *FileSystem) ReadDir(dirname string) ([]os.FileInfo, error) {
 	return list, nil
 }
 
+// FS returns fs as a *BincludeFS, adapting it to the io/fs.FS family of
+// interfaces so it can be used with html/template.ParseFS,
+// text/template.ParseFS, http.FS and other io/fs-aware APIs.
+func (fs *FileSystem) FS() *BincludeFS {
+	return &BincludeFS{FileSystem: fs}
+}
+
+// BincludeFS adapts a *FileSystem to fs.FS, fs.ReadDirFS, fs.ReadFileFS,
+// fs.StatFS and fs.SubFS. Paths use forward slashes with no leading "./" or
+// "/", as required by io/fs.
+type BincludeFS struct {
+	*FileSystem
+	root string // "" (or ".") at the top; set by Sub
+}
+
+// check that the io/fs interfaces are implemented
+var (
+	_ fs.FS         = new(BincludeFS)
+	_ fs.ReadDirFS  = new(BincludeFS)
+	_ fs.ReadFileFS = new(BincludeFS)
+	_ fs.StatFS     = new(BincludeFS)
+	_ fs.SubFS      = new(BincludeFS)
+)
+
+// HTTP adapts b back to an http.FileSystem, for code still written against
+// the original http.FileSystem-only surface.
+func (b *BincludeFS) HTTP() http.FileSystem {
+	return b.FileSystem
+}
+
+// fullName resolves name against b.root and validates it per the io/fs path
+// rules (fs.ValidPath).
+func (b *BincludeFS) fullName(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if b.root == "" || b.root == "." {
+		return name, nil
+	}
+	if name == "." {
+		return b.root, nil
+	}
+
+	return path.Join(b.root, name), nil
+}
+
+// Open implements fs.FS.
+func (b *BincludeFS) Open(name string) (fs.File, error) {
+	full, err := b.fullName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if full == "." {
+		return newFSDir(b, ".", &FileInfo{name: ".", mode: os.ModeDir, modtime: time.Time{}}), nil
+	}
+
+	f, ok := b.Files[full]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if f.Mode.IsDir() {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		return newFSDir(b, name, info), nil
+	}
+
+	f.reader = bytes.NewReader(f.Content)
+	f.path = full
+	f.fs = b.FileSystem
+
+	return f, nil
+}
+
+// ReadDir implements fs.ReadDirFS, returning entries sorted lexically by name.
+func (b *BincludeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := b.fullName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []fs.DirEntry
+	for _, p := range b.dirEntries(full) {
+		info, err := b.Files[p].Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (b *BincludeFS) ReadFile(name string) ([]byte, error) {
+	full, err := b.fullName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := b.Files[full]
+	if !ok || f.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+
+	content := make([]byte, len(f.Content))
+	copy(content, f.Content)
+
+	return content, nil
+}
+
+// Stat implements fs.StatFS.
+func (b *BincludeFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := b.fullName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if full == "." {
+		return &FileInfo{name: ".", mode: os.ModeDir, modtime: time.Time{}}, nil
+	}
+
+	f, ok := b.Files[full]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return f.Stat()
+}
+
+// Sub implements fs.SubFS. The returned FS shares the underlying Files map
+// with b, it is not copied.
+func (b *BincludeFS) Sub(dir string) (fs.FS, error) {
+	full, err := b.fullName(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if full == "." {
+		return b, nil
+	}
+
+	f, ok := b.Files[full]
+	if !ok || !f.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrNotExist}
+	}
+
+	return &BincludeFS{FileSystem: b.FileSystem, root: full}, nil
+}
+
+// fsDir adapts a directory (the synthetic "." root, or any entry with
+// Mode.IsDir()) to fs.ReadDirFile, as required by Open's io/fs contract.
+// It tracks a read cursor across calls so the standard "loop ReadDir(n)
+// until io.EOF" idiom terminates.
+type fsDir struct {
+	b    *BincludeFS
+	name string // as passed to Open, relative to b
+	info fs.FileInfo
+
+	entries []fs.DirEntry
+	read    bool
+	offset  int
+}
+
+var _ fs.ReadDirFile = new(fsDir)
+
+func newFSDir(b *BincludeFS, name string, info fs.FileInfo) *fsDir {
+	return &fsDir{b: b, name: name, info: info}
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error { return nil }
+
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.b.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if len(remaining) > n {
+		remaining = remaining[:n]
+	}
+	d.offset += len(remaining)
+
+	return remaining, nil
+}
+
+// ServeHTTP implements http.Handler. When the requested file is compressed
+// (Compression != None) and the request's Accept-Encoding lists its codec's
+// Name (e.g. gzip), the compressed bytes are written straight to the
+// response with Content-Encoding set to that name, so no decompression step
+// is needed at startup. Otherwise the content is decompressed on the fly. ETag is derived from a CRC32 of the compressed
+// bytes and checked against If-None-Match, and ModTime is checked against
+// If-Modified-Since.
+func (fs *FileSystem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+	f, ok := fs.Files[name]
+	if !ok || f.Mode.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	raw := make([]byte, hex.DecodedLen(len(f.Content)))
+	if _, err := hex.Decode(raw, f.Content); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x"`, crc32.ChecksumIEEE(raw))
+	w.Header().Set("ETag", etag)
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" && inm == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil && !f.ModTime.Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Last-Modified", f.ModTime.UTC().Format(http.TimeFormat))
+
+	codec, err := codecFor(f.Compression)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if f.Compression != None && acceptsEncoding(r, codec.Name()) {
+		w.Header().Set("Content-Encoding", codec.Name())
+		w.Write(raw)
+		return
+	}
+
+	if f.Compression == None {
+		w.Write(raw)
+		return
+	}
+
+	decoded, err := codec.Decode(bytes.NewReader(raw))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer decoded.Close()
+
+	io.Copy(w, decoded)
+}
+
+// acceptsEncoding reports whether r's Accept-Encoding header lists encoding
+// as a bare token. Entries carrying parameters (e.g. "gzip;q=0.8") do not
+// match.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(enc) == encoding {
+			return true
+		}
+	}
+
+	return false
+}
+
 // CopyFile copies a specific file from a binclude FileSystem to the hosts FileSystem.
 // Permissions are copied from the included file.
 func (fs *FileSystem) CopyFile(bincludePath, hostPath string) error {
@@ -131,43 +465,97 @@ func (fs *FileSystem) CopyFile(bincludePath, hostPath string) error {
 	return nil
 }
 
+// Encode compresses every file in fs using algo, dispatching work across a
+// pool of fs.CompressionConcurrency goroutines (runtime.NumCPU() if unset).
 func (fs *FileSystem) Encode(algo Compression) error {
-	for _, file := range fs.Files {
-		if file.Mode.IsDir() || !shouldCompress(file.Content) {
-			continue
-		}
+	return fs.EncodeSelect(func(string, string, int64) Compression { return algo })
+}
 
-		var b = &bytes.Buffer{}
+// EncodeSelect compresses every file in fs, choosing each file's Compression
+// by calling selectFn with its path, detected ContentType and size. Files
+// whose mimetype shouldCompress rejects are left at Compression == None
+// instead of calling selectFn, but are still hex-encoded like every other
+// file, so the rest of the package (Decompress, ServeHTTP, WriteTar/WriteZip)
+// can keep assuming every live File's Content is hex text. Work is
+// dispatched across a pool of fs.CompressionConcurrency goroutines
+// (runtime.NumCPU() if unset).
+func (fs *FileSystem) EncodeSelect(selectFn func(path, mime string, size int64) Compression) error {
+	workers := fs.CompressionConcurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type job struct {
+		path string
+		file *File
+	}
 
-		var writer io.WriteCloser
-		if algo == Gzip {
-			writer = gzip.NewWriter(b)
-		} else {
-			writer = NopCloser(b)
+	jobs := make(chan job)
+	errs := make(chan error, len(fs.Files))
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				algo := None
+				if shouldCompress(j.file.Content) {
+					algo = selectFn(j.path, j.file.ContentType, j.file.Size())
+				}
+				if err := encodeFile(j.file, algo); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	for path, file := range fs.Files {
+		if file.Mode.IsDir() {
+			continue
 		}
+		jobs <- job{path, file}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
 
-		_, err := writer.Write(file.Content)
-		writer.Close()
+	for err := range errs {
 		if err != nil {
 			return err
 		}
-
-		file.Compression = algo
-		file.Content = []byte(hex.EncodeToString(b.Bytes()))
 	}
 
 	return nil
 }
 
-// Compression the compression algorithm to use
-type Compression int
+// encodeFile compresses a single file in place using the Codec registered
+// for algo.
+func encodeFile(file *File, algo Compression) error {
+	codec, err := codecFor(algo)
+	if err != nil {
+		return err
+	}
 
-const (
-	// None dont compress
-	None Compression = iota
-	// Gzip use gzip compression
-	Gzip
-)
+	var b bytes.Buffer
+
+	w, err := codec.Encode(&b)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(file.Content); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	file.Compression = algo
+	file.Content = []byte(hex.EncodeToString(b.Bytes()))
+
+	return nil
+}
 
 // Decompress turns a FileSystem with compressed files into a filesystem without compressed files
 func (fs *FileSystem) Decompress() (err error) {
@@ -178,19 +566,26 @@ func (fs *FileSystem) Decompress() (err error) {
 			return err
 		}
 
-		if file.Compression == Gzip {
-			compReader, err := gzip.NewReader(bytes.NewReader(dst))
+		if file.Compression != None {
+			codec, err := codecFor(file.Compression)
+			if err != nil {
+				return err
+			}
+
+			decoded, err := codec.Decode(bytes.NewReader(dst))
 			if err != nil {
-				return fmt.Errorf("Gzip err: %v", err)
+				return fmt.Errorf("%s decode err: %v", codec.Name(), err)
 			}
 
-			dst, err = ioutil.ReadAll(compReader)
+			dst, err = ioutil.ReadAll(decoded)
+			decoded.Close()
 			if err != nil {
 				return fmt.Errorf("Reader err: %v", err)
 			}
 		}
 
 		fs.Files[path].Content = dst
+		fs.Files[path].Compression = None
 	}
 
 	return nil
@@ -225,6 +620,9 @@ type File struct {
 	Mode     os.FileMode
 	ModTime  time.Time
 	Content  []byte
+	// ContentType is the MIME type detected from the file's decompressed
+	// content at generate time, used by ServeHTTP.
+	ContentType string
 	Compression
 	reader io.ReadSeeker
 	path   string
@@ -268,13 +666,8 @@ func (f *File) Readdir(count int) (infos []os.FileInfo, err error) {
 		fileDir = filepath.Dir(f.path)
 	}
 
-	for path, file := range *&f.fs.Files {
-		if filepath.Dir(path) != fileDir {
-			continue
-		}
-
-		info, _ := file.Stat()
-
+	for _, path := range f.fs.dirEntries(fileDir) {
+		info, _ := f.fs.Files[path].Stat()
 		infos = append(infos, info)
 	}
 
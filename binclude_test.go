@@ -0,0 +1,72 @@
+package binclude
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// newTestFS builds a small FileSystem with a nested directory, mirroring
+// what bincludegen emits: hex-encoded Content and Mode carrying os.ModeDir
+// for directory entries.
+func newTestFS() *FileSystem {
+	return &FileSystem{Files: Files{
+		"a.txt":     {Filename: "a.txt", Content: []byte("68656c6c6f")},
+		"dir":       {Filename: "dir", Mode: os.ModeDir | 0755},
+		"dir/b.txt": {Filename: "b.txt", Content: []byte("776f726c64")},
+	}}
+}
+
+// TestBincludeFSConformance runs the standard io/fs conformance suite,
+// covering Stat(".") and fs.WalkDir over the root as well as the
+// ReadDir-until-EOF idiom fstest.TestFS drives on every directory.
+func TestBincludeFSConformance(t *testing.T) {
+	fsys := newTestFS()
+
+	if err := fstest.TestFS(fsys.FS(), "a.txt", "dir", "dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestServeHTTPExcludedMimetype exercises ServeHTTP for both a compressible
+// file and one shouldCompress excludes (a PNG), guarding against
+// EncodeSelect leaving excluded files' Content un-hex-encoded, which made
+// ServeHTTP's unconditional hex.Decode fail with "invalid byte".
+func TestServeHTTPExcludedMimetype(t *testing.T) {
+	txt := bytes.Repeat([]byte("compress me, please. "), 10)
+	png := append([]byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}, bytes.Repeat([]byte{0, 1, 2, 3}, 16)...)
+
+	fsys := &FileSystem{Files: Files{
+		"a.txt": {Filename: "a.txt", Content: append([]byte(nil), txt...), ModTime: time.Now()},
+		"a.png": {Filename: "a.png", Content: append([]byte(nil), png...), ModTime: time.Now()},
+	}}
+
+	if err := fsys.Encode(Gzip); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fsys.Files["a.txt"].Compression; got != Gzip {
+		t.Fatalf("a.txt Compression = %d, want Gzip", got)
+	}
+	if got := fsys.Files["a.png"].Compression; got != None {
+		t.Fatalf("a.png Compression = %d, want None (shouldCompress should have excluded it)", got)
+	}
+
+	for name, want := range map[string][]byte{"a.txt": txt, "a.png": png} {
+		req := httptest.NewRequest(http.MethodGet, "/"+name, nil)
+		rec := httptest.NewRecorder()
+
+		fsys.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", name, rec.Code, rec.Body.String())
+		}
+		if !bytes.Equal(rec.Body.Bytes(), want) {
+			t.Fatalf("%s: body does not match original content", name)
+		}
+	}
+}
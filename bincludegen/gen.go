@@ -4,6 +4,7 @@ package bincludegen
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
@@ -13,7 +14,10 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/klauspost/compress/zstd"
 	"github.com/lu4p/binclude"
 )
 
@@ -23,24 +27,48 @@ var (
 
 	fset *token.FileSet
 
-	gzip bool
+	gzip        bool
+	codec       string
+	codecLevel  int
+	concurrency int
+	filename    string
+	varName     string
 )
 
 func init() {
-	flag.BoolVar(&gzip, "gzip", false, "compress files with gzip")
+	flag.BoolVar(&gzip, "gzip", false, "compress files with gzip (shorthand for -codec gzip)")
+	flag.StringVar(&codec, "codec", "", "compression codec to use: none, gzip, zstd or br (default: none)")
+	flag.IntVar(&codecLevel, "codec-level", 0, "codec-specific compression level, e.g. 0 for gzip.NoCompression (default: each codec's default level)")
+	flag.IntVar(&concurrency, "j", 0, "number of goroutines used to compress files (default: runtime.NumCPU())")
+	flag.StringVar(&filename, "o", "binclude", "base name of the generated file(s), without build-tag suffix or extension")
+	flag.StringVar(&varName, "var", "BinFS", "name of the generated FileSystem variable")
 }
 
 // Main1 gets called by cmd/binclude for code generation
 func Main1() int {
 	flag.Parse()
-	compress := binclude.None
-	if gzip {
-		compress = binclude.Gzip
+
+	var codecLevelSet bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "codec-level" {
+			codecLevelSet = true
+		}
+	})
+
+	compress, err := parseCodecFlag(codec, gzip, codecLevel, codecLevelSet)
+	if err != nil {
+		log.Println("failed:", err)
+		return 1
 	}
 
 	log.SetPrefix("[binclude] ")
 
-	err := Generate(compress)
+	err = Generate(Options{
+		Filename:     filename,
+		VariableName: varName,
+		Compression:  compress,
+		Concurrency:  concurrency,
+	})
 	if err != nil {
 		log.Println("failed:", err)
 		return 1
@@ -49,13 +77,53 @@ func Main1() int {
 	return 0
 }
 
+// parseCodecFlag resolves the -codec/-gzip/-codec-level flags into a
+// binclude.Compression, registering a non-default level for the chosen
+// codec with binclude.RegisterCodec when levelSet is true. levelSet must
+// come from whether -codec-level was actually passed (e.g. flag.Visit),
+// not from level != 0: 0 is NoCompression, a legitimate flate/gzip level
+// distinct from DefaultCompression (-1).
+func parseCodecFlag(name string, gzipFlag bool, level int, levelSet bool) (binclude.Compression, error) {
+	if name == "" && gzipFlag {
+		name = "gzip"
+	}
+
+	var algo binclude.Compression
+	switch name {
+	case "", "none":
+		return binclude.None, nil
+	case "gzip":
+		algo = binclude.Gzip
+		if levelSet {
+			binclude.RegisterCodec(algo, binclude.NewGzipCodec(level))
+		}
+	case "zstd":
+		algo = binclude.Zstd
+		if levelSet {
+			binclude.RegisterCodec(algo, binclude.NewZstdCodec(zstd.EncoderLevel(level)))
+		}
+	case "br":
+		algo = binclude.Brotli
+		if levelSet {
+			binclude.RegisterCodec(algo, binclude.NewBrotliCodec(level))
+		}
+	default:
+		return binclude.None, fmt.Errorf("unknown -codec %q, want one of: none, gzip, zstd, br", name)
+	}
+
+	return algo, nil
+}
+
 type goFile struct {
 	path    string
 	astFile *ast.File
 }
 
-// Generate a binclude.go file for the current working directory
-func Generate(compress binclude.Compression) error {
+// Generate a set of binclude_<tag>.go files for the current working directory,
+// one per build-tag bucket, according to opts.
+func Generate(opts Options) error {
+	opts.setDefaults()
+
 	paths, _ := filepath.Glob("*.go")
 
 	if len(paths) == 0 {
@@ -66,7 +134,7 @@ func Generate(compress binclude.Compression) error {
 
 	var goFiles []goFile
 	for _, path := range paths {
-		if strings.HasSuffix(path, "binclude.go") {
+		if path == opts.Filename+".go" || strings.HasPrefix(path, opts.Filename+"_") {
 			continue
 		}
 
@@ -80,28 +148,63 @@ func Generate(compress binclude.Compression) error {
 		})
 	}
 
-	pkgName := goFiles[0].astFile.Name
+	if opts.PackageName == "" {
+		opts.PackageName = goFiles[0].astFile.Name.Name
+	}
+
+	includedFiles, excludes, err := detectIncluded(goFiles)
+	if err != nil {
+		return err
+	}
 
-	includedFiles, err := detectIncluded(goFiles)
+	ignoreFileExcludes, err := loadIgnoreFile(".bincludeignore")
 	if err != nil {
 		return err
 	}
+	excludes = append(excludes, ignoreFileExcludes...)
 
-	fileSystems, err := buildFS(includedFiles)
+	fileSystems, err := buildFS(includedFiles, excludes)
 	if err != nil {
 		return err
 	}
 
 	for _, fs := range fileSystems {
-		if err := fs.Encode(compress); err != nil {
+		fs.CompressionConcurrency = opts.Concurrency
+
+		var err error
+		if opts.CodecSelector != nil {
+			err = fs.EncodeSelect(opts.CodecSelector)
+		} else {
+			err = fs.Encode(opts.Compression)
+		}
+		if err != nil {
 			return err
 		}
 	}
 
-	return generateFiles(pkgName, fileSystems)
+	if opts.BuildTime.IsZero() {
+		opts.BuildTime = newestModTime(fileSystems)
+	}
+
+	return generateFiles(fileSystems, opts)
 }
 
-func buildFS(includedFiles []includedFile) (map[string]*binclude.FileSystem, error) {
+// newestModTime returns the most recent ModTime across every file in
+// fileSystems, used as the default Options.BuildTime.
+func newestModTime(fileSystems map[string]*binclude.FileSystem) time.Time {
+	var newest time.Time
+	for _, fs := range fileSystems {
+		for _, file := range fs.Files {
+			if file.ModTime.After(newest) {
+				newest = file.ModTime
+			}
+		}
+	}
+
+	return newest
+}
+
+func buildFS(includedFiles []includedFile, excludes []string) (map[string]*binclude.FileSystem, error) {
 	const bincludeName = "binclude"
 	fileSystems := make(map[string]*binclude.FileSystem)
 	var buildTag string
@@ -114,14 +217,22 @@ func buildFS(includedFiles []includedFile) (map[string]*binclude.FileSystem, err
 			return err
 		}
 
+		if isExcluded(excludes, filepath.ToSlash(path)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		var content []byte
+		var contentType string
 
 		if !info.IsDir() {
 			content, err = ioutil.ReadFile(path)
 			if err != nil {
 				return err
 			}
-
+			contentType = mimetype.Detect(content).String()
 		}
 
 		path = filepath.ToSlash(path)
@@ -132,16 +243,22 @@ func buildFS(includedFiles []includedFile) (map[string]*binclude.FileSystem, err
 		}
 
 		fileSystems[buildTag].Files[path] = &binclude.File{
-			Filename: info.Name(),
-			Mode:     info.Mode(),
-			ModTime:  info.ModTime(),
-			Content:  content,
+			Filename:    info.Name(),
+			Mode:        info.Mode(),
+			ModTime:     info.ModTime(),
+			Content:     content,
+			ContentType: contentType,
 		}
 
 		return nil
 	}
 
-	for _, file := range includedFiles {
+	expanded, err := expandGlobs(includedFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range expanded {
 		buildTag = ""
 
 		for _, arch := range archs {
@@ -171,11 +288,10 @@ func buildFS(includedFiles []includedFile) (map[string]*binclude.FileSystem, err
 
 type includedFile struct {
 	includedPath, goFile string
+	isGlob               bool
 }
 
-func detectIncluded(goFiles []goFile) ([]includedFile, error) {
-	var includedFiles []includedFile
-
+func detectIncluded(goFiles []goFile) (includedFiles []includedFile, excludes []string, err error) {
 	var currentGoFile string
 
 	visit := func(node ast.Node) bool {
@@ -197,7 +313,11 @@ func detectIncluded(goFiles []goFile) ([]includedFile, error) {
 			return true
 		}
 
-		if !(sel.Sel.Name == "Include" || sel.Sel.Name == "IncludeFromFile") || v.Name != "binclude" {
+		switch {
+		case v.Name != "binclude":
+			return true
+		case sel.Sel.Name != "Include" && sel.Sel.Name != "IncludeFromFile" &&
+			sel.Sel.Name != "IncludeGlob" && sel.Sel.Name != "Exclude":
 			return true
 		}
 
@@ -211,7 +331,18 @@ func detectIncluded(goFiles []goFile) ([]includedFile, error) {
 			log.Fatalln("cannot unquote string:", err)
 		}
 
-		if sel.Sel.Name == "IncludeFromFile" {
+		switch sel.Sel.Name {
+		case "Exclude":
+			excludes = append(excludes, value)
+
+		case "IncludeGlob":
+			includedFiles = append(includedFiles, includedFile{
+				goFile:       currentGoFile,
+				includedPath: value,
+				isGlob:       true,
+			})
+
+		case "IncludeFromFile":
 			content, err := ioutil.ReadFile(value)
 			if err != nil {
 				log.Fatalln("cannot read includefile:", value, "err:", err)
@@ -233,14 +364,13 @@ func detectIncluded(goFiles []goFile) ([]includedFile, error) {
 				})
 			}
 
-			return true
+		default: // Include
+			includedFiles = append(includedFiles, includedFile{
+				goFile:       currentGoFile,
+				includedPath: value,
+			})
 		}
 
-		includedFiles = append(includedFiles, includedFile{
-			goFile:       currentGoFile,
-			includedPath: value,
-		})
-
 		return true
 	}
 
@@ -250,21 +380,22 @@ func detectIncluded(goFiles []goFile) ([]includedFile, error) {
 	}
 
 	for i, file := range includedFiles {
-		var err error
-
 		if filepath.IsAbs(file.includedPath) {
-			return nil, errors.New("only supports relative include paths")
+			return nil, nil, errors.New("only supports relative include paths")
 		}
 
-		_, err = os.Stat(file.includedPath)
-		if err != nil {
-			return nil, err
+		if file.isGlob {
+			continue
+		}
+
+		if _, err := os.Stat(file.includedPath); err != nil {
+			return nil, nil, err
 		}
 
 		includedFiles[i].includedPath = strings.TrimPrefix(file.includedPath, "./")
 	}
 
-	return includedFiles, nil
+	return includedFiles, excludes, nil
 }
 
 func remove(slice []string, s int) []string {
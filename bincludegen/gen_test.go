@@ -0,0 +1,48 @@
+package bincludegen
+
+import (
+	"bytes"
+	"testing"
+
+	kgzip "github.com/klauspost/compress/gzip"
+	"github.com/lu4p/binclude"
+)
+
+// TestParseCodecFlagZeroLevel guards against -codec-level=0 being treated
+// as "flag not set": gzip.NoCompression is 0, a legitimate level distinct
+// from gzip.DefaultCompression (-1), and must be honored rather than
+// silently falling back to the codec's default.
+func TestParseCodecFlagZeroLevel(t *testing.T) {
+	content := bytes.Repeat([]byte("compress me, please. "), 200)
+
+	algo, err := parseCodecFlag("gzip", false, kgzip.BestCompression, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := encodedSize(t, algo, content)
+
+	algo, err = parseCodecFlag("gzip", false, kgzip.NoCompression, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed := encodedSize(t, algo, content)
+
+	if uncompressed <= compressed {
+		t.Fatalf("NoCompression (level 0) produced %d bytes, BestCompression produced %d bytes -- level 0 was not honored", uncompressed, compressed)
+	}
+}
+
+// encodedSize returns the hex-encoded Content length binclude.Encode
+// produces for content under algo, whatever codec is currently registered.
+func encodedSize(t *testing.T, algo binclude.Compression, content []byte) int {
+	t.Helper()
+
+	fsys := &binclude.FileSystem{Files: binclude.Files{
+		"a.txt": {Filename: "a.txt", Content: append([]byte(nil), content...)},
+	}}
+	if err := fsys.Encode(algo); err != nil {
+		t.Fatal(err)
+	}
+
+	return len(fsys.Files["a.txt"].Content)
+}
@@ -0,0 +1,88 @@
+package bincludegen
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// expandGlobs resolves every includedFile marked isGlob into one
+// includedFile per concrete match, leaving plain includes untouched.
+func expandGlobs(includedFiles []includedFile) ([]includedFile, error) {
+	var expanded []includedFile
+
+	for _, file := range includedFiles {
+		if !file.isGlob {
+			expanded = append(expanded, file)
+			continue
+		}
+
+		matches, err := doublestar.FilepathGlob(file.includedPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			expanded = append(expanded, includedFile{
+				goFile:       file.goFile,
+				includedPath: match,
+			})
+		}
+	}
+
+	return expanded, nil
+}
+
+// isExcluded reports whether p matches any exclude pattern, gitignore style:
+// patterns are tried in order and the last match wins, so a later
+// "!pattern" can re-include a path excluded by an earlier rule. p must use
+// forward slashes.
+func isExcluded(excludes []string, p string) bool {
+	excluded := false
+
+	for _, pattern := range excludes {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		pattern = strings.TrimSuffix(pattern, "/")
+
+		matched, _ := doublestar.Match(pattern, p)
+		// A slash-free pattern matches the basename at any depth, mirroring
+		// gitignore semantics (".bincludeignore" uses the same syntax).
+		if !matched && !strings.Contains(pattern, "/") {
+			matched, _ = doublestar.Match(pattern, path.Base(p))
+		}
+
+		if matched {
+			excluded = !negate
+		}
+	}
+
+	return excluded
+}
+
+// loadIgnoreFile reads exclude patterns from name (gitignore syntax: blank
+// lines and "#" comments are skipped, a leading "!" negates a pattern). It
+// returns nil, nil if name does not exist.
+func loadIgnoreFile(name string) ([]string, error) {
+	content, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+
+	return patterns, nil
+}
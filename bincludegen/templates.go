@@ -0,0 +1,212 @@
+package bincludegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lu4p/binclude"
+)
+
+// Options configures code generation, consumed by both Main1 and
+// programmatic callers of Generate.
+type Options struct {
+	// PackageName of the generated file(s); detected from the surrounding
+	// .go files in the current directory if empty.
+	PackageName string
+	// Filename is the base name (without build-tag suffix or extension) of
+	// the generated file(s), e.g. "binclude" produces binclude.go,
+	// binclude_windows.go, etc. Defaults to "binclude".
+	Filename string
+	// BuildTime stamps ModTime for every generated file entry, so repeated
+	// runs over unchanged inputs produce byte-identical output. Defaults to
+	// the newest ModTime amongst the included files.
+	BuildTime time.Time
+	// VariableName of the generated *binclude.FileSystem variable. Defaults
+	// to "BinFS".
+	VariableName string
+	// Compression algorithm applied to included file contents. Ignored if
+	// CodecSelector is set.
+	Compression binclude.Compression
+	// CodecSelector, if set, chooses the Compression for each included file
+	// individually based on its path, detected ContentType and size, taking
+	// precedence over Compression.
+	CodecSelector func(path, mime string, size int64) binclude.Compression
+	// Concurrency controls how many files are compressed in parallel;
+	// <= 0 uses runtime.NumCPU().
+	Concurrency int
+}
+
+func (o *Options) setDefaults() {
+	if o.Filename == "" {
+		o.Filename = "binclude"
+	}
+	if o.VariableName == "" {
+		o.VariableName = "BinFS"
+	}
+}
+
+// genTemplates holds the named templates used to render a generated file:
+// Header (package decl, imports, var/map opening), FileEntry (a regular
+// file's map entry), DirEntries (a directory's map entry) and Trailer
+// (closes the map/struct literal).
+var genTemplates = template.Must(template.New("gen").Parse(`
+{{define "Header"}}// Code generated by binclude. DO NOT EDIT.
+
+package {{.PackageName}}
+
+import (
+	"os"
+	"time"
+
+	"github.com/lu4p/binclude"
+)
+
+var buildTime = time.Unix({{.BuildTimeUnix}}, 0)
+
+var {{.VariableName}} = &binclude.FileSystem{Files: binclude.Files{
+{{end}}
+{{define "FileEntry"}}	{{.Path}}: &binclude.File{
+		Filename:    {{.Filename}},
+		Mode:        os.FileMode({{.Mode}}),
+		ModTime:     buildTime,
+		Content:     []byte({{.Content}}),
+		ContentType: {{.ContentType}},
+		Compression: {{.Compression}},
+	},
+{{end}}
+{{define "DirEntries"}}	{{.Path}}: &binclude.File{
+		Filename: {{.Filename}},
+		Mode:     os.FileMode({{.Mode}}),
+		ModTime:  buildTime,
+	},
+{{end}}
+{{define "Trailer"}}}}
+{{end}}
+`))
+
+// entry is the per-file/directory data passed to the FileEntry/DirEntries templates.
+type entry struct {
+	Path, Filename, Mode, Content, ContentType, Compression string
+	IsDir                                                   bool
+}
+
+// generateFiles renders one binclude_<tag>.go file per build-tag bucket in
+// fileSystems. Files entries are sorted by path so repeated runs over the
+// same inputs, with the same opts.BuildTime, are byte-identical.
+func generateFiles(fileSystems map[string]*binclude.FileSystem, opts Options) error {
+	for tag, fs := range fileSystems {
+		out, err := renderFile(opts, fs)
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(outputFilename(opts.Filename, tag), out, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// outputFilename maps a build-tag bucket key ("default", "_windows", ...) to
+// the file it is emitted to. Relying on Go's _GOOS/_GOARCH filename
+// convention means the generated files need no explicit build constraints.
+func outputFilename(base, tag string) string {
+	if tag == "default" {
+		return base + ".go"
+	}
+
+	return base + tag + ".go"
+}
+
+func renderFile(opts Options, fs *binclude.FileSystem) ([]byte, error) {
+	var buf bytes.Buffer
+
+	header := struct {
+		PackageName, VariableName string
+		BuildTimeUnix             int64
+	}{opts.PackageName, opts.VariableName, opts.BuildTime.Unix()}
+
+	if err := genTemplates.ExecuteTemplate(&buf, "Header", header); err != nil {
+		return nil, err
+	}
+
+	for _, path := range sortedPaths(fs.Files) {
+		file := fs.Files[path]
+
+		e := entry{
+			Path:     goStringLiteral(path),
+			Filename: goStringLiteral(file.Filename),
+			Mode:     fmt.Sprintf("0x%x", uint32(file.Mode)),
+		}
+
+		name := "FileEntry"
+		if file.Mode.IsDir() {
+			name = "DirEntries"
+		} else {
+			e.Content = goStringLiteral(string(file.Content))
+			e.ContentType = goStringLiteral(file.ContentType)
+			e.Compression = compressionLiteral(file.Compression)
+		}
+
+		if err := genTemplates.ExecuteTemplate(&buf, name, e); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := genTemplates.ExecuteTemplate(&buf, "Trailer", nil); err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// sortedPaths returns files' keys sorted lexically, so generated output
+// doesn't depend on Go's random map iteration order.
+func sortedPaths(files binclude.Files) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// compressionLiteral renders a binclude.Compression value as the Go
+// identifier of its constant.
+func compressionLiteral(c binclude.Compression) string {
+	switch c {
+	case binclude.Gzip:
+		return "binclude.Gzip"
+	case binclude.Zstd:
+		return "binclude.Zstd"
+	case binclude.Brotli:
+		return "binclude.Brotli"
+	default:
+		return "binclude.None"
+	}
+}
+
+// goStringLiteral renders s as a Go string literal, picking whichever of a
+// raw (backtick) literal or a quoted, escaped literal is shorter - raw
+// literals are invalid for strings containing backticks or carriage returns.
+func goStringLiteral(s string) string {
+	quoted := strconv.Quote(s)
+
+	if !strings.ContainsAny(s, "`\r") {
+		raw := "`" + s + "`"
+		if len(raw) < len(quoted) {
+			return raw
+		}
+	}
+
+	return quoted
+}
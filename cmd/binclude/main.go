@@ -0,0 +1,14 @@
+// Command binclude generates a binclude.go file embedding the files and
+// directories passed to binclude.Include/binclude.IncludeFromFile in the
+// current package.
+package main
+
+import (
+	"os"
+
+	"github.com/lu4p/binclude/bincludegen"
+)
+
+func main() {
+	os.Exit(bincludegen.Main1())
+}
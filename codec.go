@@ -0,0 +1,259 @@
+package binclude
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression identifies the codec used to compress a File's Content.
+type Compression int
+
+const (
+	// None dont compress
+	None Compression = iota
+	// Gzip use gzip compression
+	Gzip
+	// Zstd uses Zstandard compression
+	Zstd
+	// Brotli uses Brotli compression
+	Brotli
+)
+
+// Codec compresses and decompresses file content for one Compression id.
+// Encode wraps w so writes to the returned WriteCloser are compressed into
+// w; Close must be called to flush/finalize the stream. Decode wraps r so
+// reads from the returned ReadCloser yield the decompressed content.
+type Codec interface {
+	// Name identifies the codec. For codecs usable over HTTP it is also the
+	// Content-Encoding token ServeHTTP advertises/accepts ("gzip", "br", "zstd").
+	Name() string
+	Encode(w io.Writer) (io.WriteCloser, error)
+	Decode(r io.Reader) (io.ReadCloser, error)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	m map[Compression]Codec
+}{m: make(map[Compression]Codec)}
+
+// RegisterCodec registers c as the Codec used for files with Compression ==
+// id, replacing whatever was registered for id before (including the
+// built-in None/Gzip/Zstd/Brotli codecs).
+func RegisterCodec(id Compression, c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.m[id] = c
+}
+
+// codecFor returns the Codec registered for id.
+func codecFor(id Compression) (Codec, error) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	c, ok := codecs.m[id]
+	if !ok {
+		return nil, fmt.Errorf("binclude: no codec registered for compression %d", id)
+	}
+
+	return c, nil
+}
+
+func init() {
+	RegisterCodec(None, rawCodec{})
+	RegisterCodec(Gzip, gzipCodec{level: gzip.DefaultCompression})
+	RegisterCodec(Zstd, zstdCodec{level: zstd.SpeedDefault})
+	RegisterCodec(Brotli, brotliCodec{level: brotli.DefaultCompression})
+}
+
+// rawCodec is the identity Codec registered for None.
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "identity" }
+
+func (rawCodec) Encode(w io.Writer) (io.WriteCloser, error) { return NopCloser(w), nil }
+
+func (rawCodec) Decode(r io.Reader) (io.ReadCloser, error) { return ioutil.NopCloser(r), nil }
+
+const (
+	// compressionBlockThreshold is the file size above which gzipCodec
+	// splits content into independently compressed blocks instead of
+	// using a single gzip.Writer.
+	compressionBlockThreshold = 6 * 1024 * 1024 // 6 MB
+	// compressionBlockSize is the size of each independently compressed block.
+	compressionBlockSize = 1 * 1024 * 1024 // 1 MB
+	// compressionDictWindow is the amount of trailing data from the
+	// previous block carried forward as a preset dictionary for the next.
+	compressionDictWindow = 32 * 1024 // 32 KB
+)
+
+// gzipCodec is the Gzip Codec, backed by klauspost/compress/gzip for
+// throughput. Content larger than compressionBlockThreshold is split into
+// independently compressed blocks (see gzipBlocks) instead of going through
+// a single gzip.Writer.
+type gzipCodec struct{ level int }
+
+// NewGzipCodec returns a Gzip Codec compressing at level, one of the
+// compress/flate level constants (gzip.NoCompression..gzip.BestCompression,
+// or gzip.DefaultCompression).
+func NewGzipCodec(level int) Codec { return gzipCodec{level: level} }
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (c gzipCodec) Encode(w io.Writer) (io.WriteCloser, error) {
+	return &gzipEncoder{dst: w, level: c.level}, nil
+}
+
+func (gzipCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// gzipEncoder buffers every write and, on Close, emits a single valid gzip
+// member: small payloads go through one gzip.Writer, large ones are split
+// into blocks by gzipBlocks.
+type gzipEncoder struct {
+	dst   io.Writer
+	level int
+	buf   bytes.Buffer
+}
+
+func (e *gzipEncoder) Write(p []byte) (int, error) { return e.buf.Write(p) }
+
+func (e *gzipEncoder) Close() error {
+	content := e.buf.Bytes()
+
+	if len(content) > compressionBlockThreshold {
+		return gzipBlocks(e.dst, content, e.level)
+	}
+
+	w, err := gzip.NewWriterLevel(e.dst, e.level)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// gzipBlocks writes content to dst as a single valid gzip member made up of
+// independently compressed compressionBlockSize deflate blocks, stitched
+// together by flushing (flate.Writer.Flush, i.e. a sync flush) between
+// blocks and finishing (flate.Writer.Close) the last one, each compressed at
+// level. CRC32 and ISIZE are computed over the whole original content, as
+// the gzip format requires.
+func gzipBlocks(dst io.Writer, content []byte, level int) error {
+	// gzip header: magic (1f 8b), CM=8 (deflate), FLG=0, MTIME=0, XFL=0, OS=255 (unknown)
+	if _, err := dst.Write([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}); err != nil {
+		return err
+	}
+
+	var dict []byte
+	for offset := 0; offset < len(content); offset += compressionBlockSize {
+		end := offset + compressionBlockSize
+		last := end >= len(content)
+		if last {
+			end = len(content)
+		}
+		block := content[offset:end]
+
+		fw, err := flate.NewWriterDict(dst, level, dict)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fw.Write(block); err != nil {
+			return err
+		}
+
+		if last {
+			if err := fw.Close(); err != nil {
+				return err
+			}
+		} else if err := fw.Flush(); err != nil {
+			return err
+		}
+
+		dict = nextDict(dict, block)
+	}
+
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[0:4], crc32.ChecksumIEEE(content))
+	binary.LittleEndian.PutUint32(trailer[4:8], uint32(len(content)))
+	_, err := dst.Write(trailer[:])
+
+	return err
+}
+
+// nextDict returns the up-to-compressionDictWindow trailing bytes of dict+block,
+// used as the preset dictionary for the following block.
+func nextDict(dict, block []byte) []byte {
+	if len(block) >= compressionDictWindow {
+		return append([]byte(nil), block[len(block)-compressionDictWindow:]...)
+	}
+
+	combined := append(append([]byte(nil), dict...), block...)
+	if len(combined) > compressionDictWindow {
+		combined = combined[len(combined)-compressionDictWindow:]
+	}
+
+	return combined
+}
+
+// zstdCodec is the Zstd Codec, backed by klauspost/compress/zstd.
+type zstdCodec struct{ level zstd.EncoderLevel }
+
+// NewZstdCodec returns a Zstd Codec compressing at level (e.g.
+// zstd.SpeedFastest..zstd.SpeedBestCompression).
+func NewZstdCodec(level zstd.EncoderLevel) Codec { return zstdCodec{level: level} }
+
+func (zstdCodec) Name() string { return "zstd" }
+
+func (c zstdCodec) Encode(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(c.level))
+}
+
+func (zstdCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return zstdDecoder{d}, nil
+}
+
+// zstdDecoder adapts *zstd.Decoder's Close() (no error) to io.ReadCloser.
+type zstdDecoder struct{ *zstd.Decoder }
+
+func (d zstdDecoder) Close() error {
+	d.Decoder.Close()
+	return nil
+}
+
+// brotliCodec is the Brotli Codec, backed by github.com/andybalholm/brotli.
+type brotliCodec struct{ level int }
+
+// NewBrotliCodec returns a Brotli Codec compressing at level
+// (brotli.BestSpeed..brotli.BestCompression).
+func NewBrotliCodec(level int) Codec { return brotliCodec{level: level} }
+
+func (brotliCodec) Name() string { return "br" }
+
+func (c brotliCodec) Encode(w io.Writer) (io.WriteCloser, error) {
+	return brotli.NewWriterLevel(w, c.level), nil
+}
+
+func (brotliCodec) Decode(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(brotli.NewReader(r)), nil
+}
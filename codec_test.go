@@ -0,0 +1,71 @@
+package binclude
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+)
+
+// TestEncodeSelectErrorDoesNotDeadlock reproduces EncodeSelect hanging when
+// a job fails: with more jobs than the errs channel had buffer for, workers
+// blocked forever trying to report errors past the first few, and
+// EncodeSelect never returned.
+func TestEncodeSelectErrorDoesNotDeadlock(t *testing.T) {
+	files := make(Files)
+	for i := 0; i < 20; i++ {
+		name := string(rune('a'+i)) + ".txt"
+		files[name] = &File{Filename: name, Content: bytes.Repeat([]byte{'x'}, 128), ModTime: time.Time{}}
+	}
+
+	fsys := &FileSystem{Files: files, CompressionConcurrency: 2}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fsys.EncodeSelect(func(string, string, int64) Compression { return Compression(99) })
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected error for unregistered compression")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("EncodeSelect deadlocked instead of returning the codec error")
+	}
+}
+
+// TestGzipBlocksUsesConfiguredLevel ensures large files routed through the
+// block-split path honor the codec's configured level instead of always
+// compressing at flate.DefaultCompression.
+func TestGzipBlocksUsesConfiguredLevel(t *testing.T) {
+	content := bytes.Repeat([]byte("compressible payload, "), (compressionBlockThreshold/22)+1)
+
+	var fast, best bytes.Buffer
+	if err := gzipBlocks(&fast, content, gzip.BestSpeed); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipBlocks(&best, content, gzip.BestCompression); err != nil {
+		t.Fatal(err)
+	}
+
+	if best.Len() >= fast.Len() {
+		t.Fatalf("expected BestCompression output (%d bytes) to be smaller than BestSpeed output (%d bytes)", best.Len(), fast.Len())
+	}
+
+	codec := gzipCodec{level: gzip.BestCompression}
+	decoded, err := codec.Decode(bytes.NewReader(best.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoded.Close()
+
+	var got bytes.Buffer
+	if _, err := got.ReadFrom(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), content) {
+		t.Fatal("decoded content does not match original")
+	}
+}